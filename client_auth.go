@@ -0,0 +1,54 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import "fmt"
+
+// authResult indicates the outcome of a single authentication
+// attempt, shared between the client and server sides of the user
+// authentication protocol (RFC 4252).
+type authResult int
+
+const (
+	authFailure authResult = iota
+	authPartialSuccess
+	authSuccess
+)
+
+// AuthMethod is implemented by each method a client can use to
+// authenticate to a server, as listed in ClientConfig.Auth.
+type AuthMethod interface {
+	// method returns the SSH authentication method name this value
+	// implements, e.g. "password" or "publickey".
+	method() string
+}
+
+// clientAuthenticate runs the SSH user authentication protocol
+// (RFC 4252) for a freshly handshaken client connection.
+// config.PeerID is tried first, since it needs no key or password,
+// only the already-verified libp2p identity. The methods in
+// config.Auth are not offered to the server: if the peer ID method is
+// not configured or does not succeed, their names are only listed, in
+// order, in the returned error.
+func (c *connection) clientAuthenticate(session []byte, config *ClientConfig) error {
+	tried := make([]string, 0, len(config.Auth)+1)
+
+	if config.PeerID != "" {
+		tried = append(tried, peerIDAuthMethod)
+		result, _, err := c.peerID(session, config)
+		if err != nil {
+			return fmt.Errorf("ssh: %s auth: %w", peerIDAuthMethod, err)
+		}
+		if result == authSuccess {
+			return nil
+		}
+	}
+
+	for _, auth := range config.Auth {
+		tried = append(tried, auth.method())
+	}
+
+	return fmt.Errorf("ssh: unable to authenticate, attempted methods %v", tried)
+}
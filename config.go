@@ -0,0 +1,168 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Config holds certain configuration data used by both ServerConfig
+// and ClientConfig.
+type Config struct {
+	// Rand provides the source of entropy for key exchange. If Rand is
+	// nil, the cryptographically secure random number generator from
+	// the crypto/rand package is used.
+	Rand io.Reader
+
+	// RekeyThreshold is the number of bytes sent or received after
+	// which a new key exchange is negotiated. It must be at least
+	// 256. If unspecified, a size suitable for the chosen cipher is
+	// used.
+	RekeyThreshold uint64
+
+	// RekeyInterval is the maximum amount of time a key exchange is
+	// allowed to stay in effect before a new one is negotiated,
+	// regardless of RekeyThreshold. Unlike RekeyThreshold, which
+	// protects ciphers against overuse, this guards against a
+	// connection that stays open but nearly idle for a long time -
+	// the common case for an SSH session carried over a long-lived
+	// libp2p stream. Zero disables the time-based rekey.
+	RekeyInterval time.Duration
+
+	// The allowed key exchange algorithms. If unspecified then a
+	// default set of algorithms is used.
+	KeyExchanges []string
+
+	// The allowed cipher algorithms. If unspecified then a sensible
+	// default is used.
+	Ciphers []string
+
+	// The allowed MAC algorithms. If unspecified then a sensible
+	// default is used.
+	MACs []string
+}
+
+// ClientConfig is the configuration for a Client, used both when
+// authenticating and for the lifetime of the resulting connection.
+type ClientConfig struct {
+	Config
+
+	// User is the username to authenticate as.
+	User string
+
+	// Auth lists further authentication methods. They are not offered
+	// to the server; their names only appear, in order, in the error
+	// returned when authentication fails.
+	Auth []AuthMethod
+
+	// PeerID, if non-empty, makes the client offer the
+	// "libp2p-peerid" authentication method, relying on the libp2p
+	// connection's already-verified remote peer ID instead of
+	// presenting a password or key.
+	PeerID string
+
+	// HostKeyCallback verifies the server host key during the
+	// handshake.
+	HostKeyCallback HostKeyCallback
+
+	// ClientVersion, if set, is used as the client's identification
+	// string during the handshake.
+	ClientVersion string
+
+	// ReconnectPolicy, if non-nil, makes Dial redial automatically
+	// when the underlying libp2p stream is lost. See ReconnectPolicy.
+	ReconnectPolicy *ReconnectPolicy
+}
+
+// ServerConfig configures a server's connection handling and
+// authentication.
+type ServerConfig struct {
+	Config
+
+	// NoClientAuth, if true, accepts connections without any
+	// authentication.
+	NoClientAuth bool
+
+	// MaxAuthTries is the maximum number of authentication attempts
+	// permitted per connection. Zero means unlimited.
+	MaxAuthTries int
+
+	// PasswordCallback is not called: a "password" attempt fails
+	// whether or not it is set, with an error that says whether it was.
+	PasswordCallback func(conn ConnMetadata, password []byte) (*Permissions, error)
+
+	// PublicKeyCallback is not called: a "publickey" attempt fails
+	// whether or not it is set, with an error that says whether it was.
+	PublicKeyCallback func(conn ConnMetadata, key PublicKey) (*Permissions, error)
+
+	// PeerIDCallback, if non-nil, is called when a client offers the
+	// "libp2p-peerid" authentication method. See PeerIDCallback.
+	PeerIDCallback PeerIDCallback
+
+	// ServerVersion, if set, is used as the server's identification
+	// string during the handshake.
+	ServerVersion string
+
+	hostKeysMu     sync.RWMutex
+	hostKeys       []Signer
+	hostKeyManager *HostKeyManager
+}
+
+// AddHostKey sets a host key for use by the server. Only one host key
+// per key type (ssh-rsa, ssh-ed25519, etc.) is kept: adding a key
+// whose type matches one already added replaces it rather than
+// appending a second key of the same type.
+//
+// AddHostKey is safe to call concurrently with itself, with
+// SetHostKeyManager, and with a HostKeyManager rotation in progress;
+// it never mutates a slice a concurrent HostKeys caller may be
+// holding, only swaps in a new one.
+func (s *ServerConfig) AddHostKey(key Signer) {
+	s.hostKeysMu.Lock()
+	defer s.hostKeysMu.Unlock()
+	s.hostKeys = withHostKey(s.hostKeys, key)
+}
+
+// replaceHostKeys swaps out s's entire host-key list for keys,
+// including any key added directly via AddHostKey. Unlike AddHostKey,
+// it keeps every key in keys, even several of the same type, so a
+// HostKeyManager's current and retired keys are listed together. It
+// builds the replacement list before taking the lock, so a
+// concurrent HostKeys call never observes a partially rebuilt list.
+func (s *ServerConfig) replaceHostKeys(keys []Signer) {
+	next := make([]Signer, len(keys))
+	copy(next, keys)
+
+	s.hostKeysMu.Lock()
+	s.hostKeys = next
+	s.hostKeysMu.Unlock()
+}
+
+// HostKeys returns a snapshot of the server's current host keys. The
+// handshake code that announces these keys to a connecting client
+// must call HostKeys instead of reading a ServerConfig's host-key list
+// directly, since AddHostKey, replaceHostKeys and a HostKeyManager
+// rotation can all run concurrently with an in-flight handshake.
+func (s *ServerConfig) HostKeys() []Signer {
+	s.hostKeysMu.RLock()
+	defer s.hostKeysMu.RUnlock()
+	return s.hostKeys
+}
+
+// withHostKey returns keys with key inserted, replacing any existing
+// entry of the same public key type rather than mutating keys itself.
+func withHostKey(keys []Signer, key Signer) []Signer {
+	next := make([]Signer, len(keys))
+	copy(next, keys)
+	for i, k := range next {
+		if k.PublicKey().Type() == key.PublicKey().Type() {
+			next[i] = key
+			return next
+		}
+	}
+	return append(next, key)
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 
 	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
 	ma "github.com/multiformats/go-multiaddr"
 )
 
@@ -43,6 +44,12 @@ type ConnMetadata interface {
 
 	// LocalAddr returns the local address for this connection.
 	LocalMultiaddr() ma.Multiaddr
+
+	// RemotePeer returns the libp2p peer ID of the remote side, as
+	// authenticated by the underlying libp2p connection. It is valid
+	// regardless of which SSH authentication method was used, since
+	// the peer ID is established below the SSH layer.
+	RemotePeer() peer.ID
 }
 
 // Conn represents an SSH connection for both server and client roles.
@@ -71,9 +78,81 @@ type Conn interface {
 	// error causing the shutdown.
 	Wait() error
 
-	// TODO(hanwen): consider exposing:
-	//   RequestKeyChange
-	//   Disconnect
+	// RequestKeyChange asks the remote side to perform a key
+	// exchange, regardless of whether a rekey is considered
+	// necessary. This is useful for long-lived connections, such as
+	// a libp2p stream that may remain open for days, where the peer
+	// may want to force a rekey on its own schedule rather than wait
+	// for the automatic thresholds to trigger one. Per RFC 4253,
+	// section 9, either the client or the server may initiate a key
+	// re-exchange at any time, so RequestKeyChange is available on
+	// both client and server connections.
+	RequestKeyChange() error
+
+	// Disconnect sends an SSH_MSG_DISCONNECT to the peer with the
+	// given reason code and human-readable message, as described in
+	// RFC 4253, section 11.1, and then closes the underlying
+	// connection. Use this instead of Close to let the peer know why
+	// the connection is being torn down.
+	Disconnect(reason DisconnectReason, message string) error
+}
+
+// DisconnectReason is the reason code sent in an SSH_MSG_DISCONNECT
+// message, as defined in RFC 4253, section 11.1.
+type DisconnectReason uint32
+
+// The disconnect reason codes defined by RFC 4253, section 11.1.
+const (
+	DisconnectHostNotAllowedToConnect     DisconnectReason = 1
+	DisconnectProtocolError               DisconnectReason = 2
+	DisconnectKeyExchangeFailed           DisconnectReason = 3
+	DisconnectReserved                    DisconnectReason = 4
+	DisconnectMACError                    DisconnectReason = 5
+	DisconnectCompressionError            DisconnectReason = 6
+	DisconnectServiceNotAvailable         DisconnectReason = 7
+	DisconnectProtocolVersionNotSupported DisconnectReason = 8
+	DisconnectHostKeyNotVerifiable        DisconnectReason = 9
+	DisconnectConnectionLost              DisconnectReason = 10
+	DisconnectByApplication               DisconnectReason = 11
+	DisconnectTooManyConnections          DisconnectReason = 12
+	DisconnectAuthCancelledByUser         DisconnectReason = 13
+	DisconnectNoMoreAuthMethodsAvailable  DisconnectReason = 14
+	DisconnectIllegalUserName             DisconnectReason = 15
+)
+
+func (r DisconnectReason) String() string {
+	switch r {
+	case DisconnectHostNotAllowedToConnect:
+		return "host not allowed to connect"
+	case DisconnectProtocolError:
+		return "protocol error"
+	case DisconnectKeyExchangeFailed:
+		return "key exchange failed"
+	case DisconnectMACError:
+		return "mac error"
+	case DisconnectCompressionError:
+		return "compression error"
+	case DisconnectServiceNotAvailable:
+		return "service not available"
+	case DisconnectProtocolVersionNotSupported:
+		return "protocol version not supported"
+	case DisconnectHostKeyNotVerifiable:
+		return "host key not verifiable"
+	case DisconnectConnectionLost:
+		return "connection lost"
+	case DisconnectByApplication:
+		return "disconnected by application"
+	case DisconnectTooManyConnections:
+		return "too many connections"
+	case DisconnectAuthCancelledByUser:
+		return "auth cancelled by user"
+	case DisconnectNoMoreAuthMethodsAvailable:
+		return "no more auth methods available"
+	case DisconnectIllegalUserName:
+		return "illegal user name"
+	default:
+		return fmt.Sprintf("unknown reason %d", uint32(r))
+	}
 }
 
 // DiscardRequests consumes and rejects all requests from the
@@ -99,6 +178,20 @@ func (c *connection) Close() error {
 	return c.sshConn.stream.Close()
 }
 
+// RequestKeyChange implements Conn.RequestKeyChange.
+func (c *connection) RequestKeyChange() error {
+	return c.transport.requestKeyChange()
+}
+
+// Disconnect implements Conn.Disconnect.
+func (c *connection) Disconnect(reason DisconnectReason, message string) error {
+	c.transport.conn.writePacket(Marshal(&disconnectMsg{
+		Reason:  uint32(reason),
+		Message: message,
+	}))
+	return c.Close()
+}
+
 // sshconn provides net.Conn metadata, but disallows direct reads and
 // writes.
 type sshConn struct {
@@ -132,6 +225,10 @@ func (c *sshConn) LocalMultiaddr() ma.Multiaddr {
 	return c.stream.Conn().LocalMultiaddr()
 }
 
+func (c *sshConn) RemotePeer() peer.ID {
+	return c.stream.Conn().RemotePeer()
+}
+
 func (c *sshConn) SessionID() []byte {
 	return dup(c.sessionID)
 }
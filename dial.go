@@ -0,0 +1,288 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+)
+
+// ReconnectPolicy controls whether, and how, a connection opened with
+// Dial re-establishes its underlying libp2p stream after that stream
+// is lost. A nil *ReconnectPolicy on ClientConfig disables
+// reconnection entirely; Dial then behaves exactly as before.
+type ReconnectPolicy struct {
+	// MaxAttempts bounds how many consecutive redials are attempted
+	// after a single stream loss before giving up. Zero means retry
+	// indefinitely.
+	MaxAttempts int
+
+	// Backoff is called before each redial attempt (1-indexed) to
+	// determine how long to sleep first. A nil Backoff redials
+	// immediately.
+	Backoff func(attempt int) time.Duration
+
+	// ShouldReconnect is consulted with the error returned by the
+	// lost connection's Wait. Returning false treats err as fatal and
+	// stops reconnecting. A nil ShouldReconnect reconnects after any
+	// error.
+	ShouldReconnect func(err error) bool
+}
+
+func (p *ReconnectPolicy) backoff(attempt int) time.Duration {
+	if p == nil || p.Backoff == nil {
+		return 0
+	}
+	return p.Backoff(attempt)
+}
+
+func (p *ReconnectPolicy) shouldReconnect(err error) bool {
+	if p == nil {
+		return false
+	}
+	if p.ShouldReconnect == nil {
+		return true
+	}
+	return p.ShouldReconnect(err)
+}
+
+// Dial opens a libp2p stream to target on protocol id using h, and
+// runs the SSH client handshake over it. h must already be able to
+// reach target, i.e. target's multiaddrs have been added to h's
+// peerstore (via h.Peerstore().AddAddrs) or are discoverable through
+// h's routing.
+//
+// The returned *ReconnectingClient always has a Client reachable via
+// Current; once reconnection has permanently given up, that Client is
+// no longer live and Current also returns the error that ended it. If config.ReconnectPolicy is nil, Current always
+// returns the same, original connection and Wait simply waits for it
+// to close. If ReconnectPolicy is set, a lost stream is redialed in
+// the background according to the policy, and callers must call
+// Current again after noticing a failure to pick up the replacement -
+// holding on to a *Client obtained from an earlier Current call will
+// not observe the reconnect. Higher-level session state (open
+// channels, in-flight requests) is not preserved across a reconnect;
+// callers that care must re-establish it themselves, for example by
+// recreating sessions from the new Client once Current changes.
+func Dial(ctx context.Context, h host.Host, target peer.ID, id protocol.ID, config *ClientConfig) (*ReconnectingClient, error) {
+	client, err := dialOnce(ctx, h, target, id, config)
+	if err != nil {
+		return nil, err
+	}
+
+	rc := &ReconnectingClient{
+		client:  client,
+		stopped: make(chan struct{}),
+		ctx:     ctx,
+		host:    h,
+		target:  target,
+		proto:   id,
+		config:  config,
+	}
+	if config.ReconnectPolicy != nil {
+		go rc.run()
+	}
+	return rc, nil
+}
+
+func dialOnce(ctx context.Context, h host.Host, target peer.ID, id protocol.ID, config *ClientConfig) (*Client, error) {
+	stream, err := h.NewStream(ctx, target, id)
+	if err != nil {
+		return nil, fmt.Errorf("ssh: opening libp2p stream to %s: %w", target, err)
+	}
+	conn, chans, reqs, err := NewClientConn(stream, target.String(), config)
+	if err != nil {
+		stream.Close()
+		return nil, err
+	}
+	return NewClient(conn, chans, reqs), nil
+}
+
+// ReconnectingClient watches a *Client created by Dial and redials
+// according to its ReconnectPolicy whenever the underlying stream is
+// lost. It is not constructed directly; Dial returns one for every
+// connection, and it only watches and redials when
+// ClientConfig.ReconnectPolicy is set.
+type ReconnectingClient struct {
+	mu      sync.Mutex
+	client  *Client
+	err     error
+	stopped chan struct{}
+
+	ctx    context.Context
+	host   host.Host
+	target peer.ID
+	proto  protocol.ID
+	config *ClientConfig
+}
+
+// Current returns the live *Client. After a transient stream loss and
+// successful redial this may differ from the value most recently
+// returned; callers that hold a *Client across a reconnect should
+// prefer calling Current again rather than reusing the old value.
+func (r *ReconnectingClient) Current() (*Client, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.client, r.err
+}
+
+// Wait blocks until the connection is permanently gone and returns the
+// error that ended it. With no ReconnectPolicy this is just the
+// original Client's Wait. With a policy set, it instead blocks until
+// reconnection has permanently given up — either ShouldReconnect
+// rejected the error, MaxAttempts was exceeded, or ctx was cancelled.
+func (r *ReconnectingClient) Wait() error {
+	if r.config.ReconnectPolicy == nil {
+		client, _ := r.Current()
+		return client.Wait()
+	}
+	<-r.stopped
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *ReconnectingClient) run() {
+	for {
+		r.mu.Lock()
+		client := r.client
+		r.mu.Unlock()
+
+		waitErr := client.Wait()
+		policy := r.config.ReconnectPolicy
+		if !policy.shouldReconnect(waitErr) {
+			r.fail(waitErr)
+			return
+		}
+
+		next, err := r.reconnect(policy)
+		if err != nil {
+			r.fail(fmt.Errorf("ssh: giving up reconnecting to %s after stream loss (%v): %w", r.target, waitErr, err))
+			return
+		}
+
+		r.mu.Lock()
+		r.client = next
+		r.mu.Unlock()
+	}
+}
+
+func (r *ReconnectingClient) reconnect(policy *ReconnectPolicy) (*Client, error) {
+	var lastErr error
+	for attempt := 1; policy.MaxAttempts == 0 || attempt <= policy.MaxAttempts; attempt++ {
+		if err := r.ctx.Err(); err != nil {
+			return nil, err
+		}
+		if d := policy.backoff(attempt); d > 0 {
+			select {
+			case <-time.After(d):
+			case <-r.ctx.Done():
+				return nil, r.ctx.Err()
+			}
+		}
+		client, err := dialOnce(r.ctx, r.host, r.target, r.proto, r.config)
+		if err == nil {
+			return client, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func (r *ReconnectingClient) fail(err error) {
+	r.mu.Lock()
+	r.err = err
+	r.mu.Unlock()
+	close(r.stopped)
+}
+
+// Listener accepts incoming SSH connections multiplexed over libp2p
+// streams opened on a single protocol ID, analogous to a net.Listener
+// for a plain TCP-based SSH server.
+type Listener struct {
+	host     host.Host
+	protocol protocol.ID
+	config   *ServerConfig
+	streams  chan network.Stream
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// Listen registers a stream handler for id on h and returns a
+// Listener whose Accept runs the SSH server handshake, as described by
+// config, over each inbound stream in turn. Call Close to unregister
+// the handler and stop accepting.
+func Listen(h host.Host, id protocol.ID, config *ServerConfig) (*Listener, error) {
+	l := &Listener{
+		host:     h,
+		protocol: id,
+		config:   config,
+		streams:  make(chan network.Stream),
+		closed:   make(chan struct{}),
+	}
+	h.SetStreamHandler(id, func(s network.Stream) {
+		select {
+		case l.streams <- s:
+		case <-l.closed:
+			s.Reset()
+		}
+	})
+	return l, nil
+}
+
+// Accept blocks until a peer opens a new stream on the listener's
+// protocol ID, runs the SSH server handshake over it using the
+// ServerConfig passed to Listen, and returns the resulting connection
+// along with the channels for incoming SSH channels and global
+// requests - the same triple NewServerConn returns directly, so
+// callers never have to drive the handshake themselves.
+func (l *Listener) Accept() (*ServerConn, <-chan NewChannel, <-chan *Request, error) {
+	stream, err := l.nextStream()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	conn, chans, reqs, err := NewServerConn(stream, l.config)
+	if err != nil {
+		stream.Close()
+		return nil, nil, nil, err
+	}
+	if l.config.hostKeyManager != nil {
+		l.config.hostKeyManager.Track(conn)
+	}
+	return conn, chans, reqs, nil
+}
+
+// nextStream blocks until a peer opens a new stream on the listener's
+// protocol ID, or the listener is closed.
+func (l *Listener) nextStream() (network.Stream, error) {
+	select {
+	case s := <-l.streams:
+		return s, nil
+	case <-l.closed:
+		return nil, fmt.Errorf("ssh: listener closed")
+	}
+}
+
+// Close stops accepting new streams and unregisters the protocol
+// handler. It is safe to call more than once and on a Listener whose
+// Listen call has not run its SetStreamHandler yet.
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() {
+		if l.host != nil {
+			l.host.RemoveStreamHandler(l.protocol)
+		}
+		close(l.closed)
+	})
+	return nil
+}
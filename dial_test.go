@@ -0,0 +1,90 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/network"
+)
+
+func TestReconnectPolicyBackoff(t *testing.T) {
+	var nilPolicy *ReconnectPolicy
+	if got := nilPolicy.backoff(1); got != 0 {
+		t.Fatalf("nil policy backoff = %v, want 0", got)
+	}
+
+	noBackoff := &ReconnectPolicy{}
+	if got := noBackoff.backoff(3); got != 0 {
+		t.Fatalf("policy with nil Backoff = %v, want 0", got)
+	}
+
+	p := &ReconnectPolicy{Backoff: func(attempt int) time.Duration {
+		return time.Duration(attempt) * time.Second
+	}}
+	if got, want := p.backoff(3), 3*time.Second; got != want {
+		t.Fatalf("backoff(3) = %v, want %v", got, want)
+	}
+}
+
+func TestReconnectPolicyShouldReconnect(t *testing.T) {
+	var nilPolicy *ReconnectPolicy
+	if nilPolicy.shouldReconnect(errors.New("boom")) {
+		t.Fatal("nil policy shouldReconnect = true, want false")
+	}
+
+	always := &ReconnectPolicy{}
+	if !always.shouldReconnect(errors.New("boom")) {
+		t.Fatal("policy with nil ShouldReconnect = false, want true")
+	}
+
+	never := &ReconnectPolicy{ShouldReconnect: func(error) bool { return false }}
+	if never.shouldReconnect(errors.New("boom")) {
+		t.Fatal("policy with ShouldReconnect returning false = true, want false")
+	}
+}
+
+func TestListenerAcceptReturnsErrorAfterClose(t *testing.T) {
+	l := &Listener{streams: make(chan network.Stream), closed: make(chan struct{})}
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, _, _, err := l.Accept(); err == nil {
+		t.Fatal("Accept after Close: got nil error, want one")
+	}
+	// Close must be safe to call again, including on a Listener whose
+	// host field was never set (as here).
+	if err := l.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+}
+
+func TestListenerNextStreamHandsOffQueuedStream(t *testing.T) {
+	l := &Listener{streams: make(chan network.Stream, 1), closed: make(chan struct{})}
+	var want network.Stream
+	l.streams <- want
+
+	done := make(chan struct{})
+	var got network.Stream
+	var err error
+	go func() {
+		got, err = l.nextStream()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		if err != nil {
+			t.Fatalf("nextStream: %v", err)
+		}
+		if got != want {
+			t.Fatalf("nextStream returned %v, want the queued stream", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("nextStream did not return the queued stream")
+	}
+}
@@ -0,0 +1,434 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+)
+
+// HostKeyAlgo identifies a host-key algorithm that a HostKeyManager
+// can generate and persist.
+type HostKeyAlgo string
+
+// The host-key algorithms a HostKeyManager knows how to generate.
+const (
+	HostKeyAlgoEd25519 HostKeyAlgo = "ssh-ed25519"
+	HostKeyAlgoRSA     HostKeyAlgo = "ssh-rsa"
+	HostKeyAlgoECDSA   HostKeyAlgo = "ecdsa-sha2-nistp256"
+)
+
+// HostKeyStorage persists the PEM-encoded private host keys managed by
+// a HostKeyManager. Implementations must be safe for concurrent use.
+type HostKeyStorage interface {
+	// Load returns the stored keys, keyed by the name under which
+	// they were saved. It returns an empty map, not an error, if no
+	// keys have been saved yet.
+	Load() (map[string][]byte, error)
+
+	// Save persists the given PEM blocks, overwriting any existing
+	// entry with the same name.
+	Save(name string, pemBytes []byte) error
+
+	// Delete removes a previously saved entry. It is not an error to
+	// delete a name that was never saved.
+	Delete(name string) error
+}
+
+// FileHostKeyStorage persists host keys as PEM files in a directory on
+// disk, one file per key, named "<name>.pem".
+type FileHostKeyStorage struct {
+	Dir string
+}
+
+// NewFileHostKeyStorage returns a FileHostKeyStorage rooted at dir,
+// creating the directory with mode 0700 if it does not already exist.
+func NewFileHostKeyStorage(dir string) (*FileHostKeyStorage, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("ssh: creating host key dir: %w", err)
+	}
+	return &FileHostKeyStorage{Dir: dir}, nil
+}
+
+func (s *FileHostKeyStorage) path(name string) string {
+	return filepath.Join(s.Dir, name+".pem")
+}
+
+func (s *FileHostKeyStorage) Load() (map[string][]byte, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return map[string][]byte{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	keys := map[string][]byte{}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".pem" {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(s.Dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		name := e.Name()[:len(e.Name())-len(".pem")]
+		keys[name] = b
+	}
+	return keys, nil
+}
+
+func (s *FileHostKeyStorage) Save(name string, pemBytes []byte) error {
+	return os.WriteFile(s.path(name), pemBytes, 0600)
+}
+
+func (s *FileHostKeyStorage) Delete(name string) error {
+	err := os.Remove(s.path(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// MemoryHostKeyStorage keeps host keys in memory only. It is mainly
+// useful for tests and for servers that are happy to generate a fresh
+// identity on every restart.
+type MemoryHostKeyStorage struct {
+	mu   sync.Mutex
+	keys map[string][]byte
+}
+
+// NewMemoryHostKeyStorage returns an empty in-memory HostKeyStorage.
+func NewMemoryHostKeyStorage() *MemoryHostKeyStorage {
+	return &MemoryHostKeyStorage{keys: map[string][]byte{}}
+}
+
+func (s *MemoryHostKeyStorage) Load() (map[string][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string][]byte, len(s.keys))
+	for k, v := range s.keys {
+		out[k] = dup(v)
+	}
+	return out, nil
+}
+
+func (s *MemoryHostKeyStorage) Save(name string, pemBytes []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[name] = dup(pemBytes)
+	return nil
+}
+
+func (s *MemoryHostKeyStorage) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, name)
+	return nil
+}
+
+// DatastoreHostKeyStorage persists host keys in a libp2p go-datastore,
+// under keys namespaced by prefix. This lets a host share the same
+// datastore it already uses for its libp2p peerstore and DHT records
+// rather than managing a separate directory of key files.
+type DatastoreHostKeyStorage struct {
+	ds     ds.Datastore
+	prefix ds.Key
+}
+
+// NewDatastoreHostKeyStorage returns a HostKeyStorage backed by store,
+// namespacing all entries under prefix (for example "/ssh/hostkeys").
+func NewDatastoreHostKeyStorage(store ds.Datastore, prefix string) *DatastoreHostKeyStorage {
+	return &DatastoreHostKeyStorage{ds: store, prefix: ds.NewKey(prefix)}
+}
+
+func (s *DatastoreHostKeyStorage) key(name string) ds.Key {
+	return s.prefix.ChildString(name)
+}
+
+func (s *DatastoreHostKeyStorage) Load() (map[string][]byte, error) {
+	q := dsq.Query{Prefix: s.prefix.String()}
+	results, err := s.ds.Query(q)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	keys := map[string][]byte{}
+	for r := range results.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		name := ds.RawKey(r.Key).Name()
+		keys[name] = r.Value
+	}
+	return keys, nil
+}
+
+func (s *DatastoreHostKeyStorage) Save(name string, pemBytes []byte) error {
+	return s.ds.Put(s.key(name), pemBytes)
+}
+
+func (s *DatastoreHostKeyStorage) Delete(name string) error {
+	return s.ds.Delete(s.key(name))
+}
+
+// HostKeyManager loads, generates, persists and rotates a server's
+// host keys. A single manager may hold keys for several algorithms at
+// once; ActiveKeys returns all of them so they can all be announced to
+// clients via ServerConfig.SetHostKeyManager.
+//
+// Rotation is atomic with respect to ActiveKeys: Rotate first generates
+// and persists the new key, then keeps the key it replaces around for
+// GracePeriod so that connections mid-handshake, or clients that have
+// cached the old key in their known_hosts, continue to be accepted
+// during the overlap.
+type HostKeyManager struct {
+	storage HostKeyStorage
+
+	// GracePeriod is how long a rotated-out key is still returned by
+	// ActiveKeys and accepted for incoming connections. Zero means
+	// the old key is dropped immediately.
+	GracePeriod time.Duration
+
+	// OnRotate, if set, is called after a successful Rotate with the
+	// algorithm that was rotated. Callers typically use this hook to
+	// call RequestKeyChange on their active connections so peers pick
+	// up the new host key without waiting for their next connection.
+	OnRotate func(algo HostKeyAlgo)
+
+	mu       sync.Mutex
+	current  map[HostKeyAlgo]Signer
+	retired  map[HostKeyAlgo]retiredKey
+	ensuring map[HostKeyAlgo]chan struct{}
+
+	connMu sync.Mutex
+	conns  []Conn
+}
+
+type retiredKey struct {
+	signer  Signer
+	expires time.Time
+}
+
+// NewHostKeyManager returns a HostKeyManager that persists keys via
+// storage, loading any keys already present.
+func NewHostKeyManager(storage HostKeyStorage) (*HostKeyManager, error) {
+	m := &HostKeyManager{
+		storage: storage,
+		current: map[HostKeyAlgo]Signer{},
+		retired: map[HostKeyAlgo]retiredKey{},
+	}
+	pemKeys, err := storage.Load()
+	if err != nil {
+		return nil, fmt.Errorf("ssh: loading host keys: %w", err)
+	}
+	for name, pemBytes := range pemKeys {
+		algo := HostKeyAlgo(name)
+		signer, err := parseHostKeyPEM(pemBytes)
+		if err != nil {
+			return nil, fmt.Errorf("ssh: parsing stored host key %q: %w", name, err)
+		}
+		m.current[algo] = signer
+	}
+	return m, nil
+}
+
+// Ensure makes sure a key for algo exists, generating and persisting
+// one if it does not. Concurrent calls for the same algo that find no
+// existing key all wait on a single in-flight generation rather than
+// each generating and persisting their own key.
+func (m *HostKeyManager) Ensure(algo HostKeyAlgo) (Signer, error) {
+	for {
+		m.mu.Lock()
+		if s, ok := m.current[algo]; ok {
+			m.mu.Unlock()
+			return s, nil
+		}
+		if done, ok := m.ensuring[algo]; ok {
+			m.mu.Unlock()
+			<-done
+			continue
+		}
+		done := make(chan struct{})
+		if m.ensuring == nil {
+			m.ensuring = map[HostKeyAlgo]chan struct{}{}
+		}
+		m.ensuring[algo] = done
+		m.mu.Unlock()
+
+		signer, err := m.Rotate(algo)
+
+		m.mu.Lock()
+		delete(m.ensuring, algo)
+		m.mu.Unlock()
+		close(done)
+
+		return signer, err
+	}
+}
+
+// Track registers conn as a live connection that should be asked to
+// RequestKeyChange whenever this manager's host keys rotate. Server
+// code should call Track once a connection's handshake has completed;
+// a connection never needs to be explicitly untracked - once its Wait
+// returns, RequestKeyChange calls against it simply fail and are
+// ignored.
+func (m *HostKeyManager) Track(conn Conn) {
+	m.connMu.Lock()
+	defer m.connMu.Unlock()
+	m.conns = append(m.conns, conn)
+}
+
+// rekeyTracked asks every tracked connection to perform a key change,
+// dropping any that are no longer accepting requests.
+func (m *HostKeyManager) rekeyTracked() {
+	m.connMu.Lock()
+	live := m.conns[:0]
+	for _, c := range m.conns {
+		if c.RequestKeyChange() == nil {
+			live = append(live, c)
+		}
+	}
+	m.conns = live
+	m.connMu.Unlock()
+}
+
+// Rotate generates a fresh key for algo, persists it, and makes it the
+// active key returned by ActiveKeys. The key it replaces, if any,
+// keeps being returned by ActiveKeys until GracePeriod elapses.
+func (m *HostKeyManager) Rotate(algo HostKeyAlgo) (Signer, error) {
+	signer, pemBytes, err := generateHostKey(algo)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.storage.Save(string(algo), pemBytes); err != nil {
+		return nil, fmt.Errorf("ssh: persisting rotated host key: %w", err)
+	}
+
+	m.mu.Lock()
+	if old, ok := m.current[algo]; ok && m.GracePeriod > 0 {
+		m.retired[algo] = retiredKey{signer: old, expires: time.Now().Add(m.GracePeriod)}
+	}
+	m.current[algo] = signer
+	m.mu.Unlock()
+
+	if m.OnRotate != nil {
+		m.OnRotate(algo)
+	}
+	return signer, nil
+}
+
+// ActiveKeys returns every key that should currently be announced as a
+// server host key: the current key for each algorithm plus any
+// recently-rotated keys still inside their grace period.
+func (m *HostKeyManager) ActiveKeys() []Signer {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]Signer, 0, len(m.current)+len(m.retired))
+	for _, s := range m.current {
+		keys = append(keys, s)
+	}
+	for algo, r := range m.retired {
+		if now.After(r.expires) {
+			delete(m.retired, algo)
+			continue
+		}
+		keys = append(keys, r.signer)
+	}
+	return keys
+}
+
+func generateHostKey(algo HostKeyAlgo) (Signer, []byte, error) {
+	var (
+		der     []byte
+		err     error
+		pemType string
+	)
+	switch algo {
+	case HostKeyAlgoEd25519:
+		_, priv, genErr := ed25519.GenerateKey(rand.Reader)
+		if genErr != nil {
+			return nil, nil, genErr
+		}
+		der, err = x509.MarshalPKCS8PrivateKey(priv)
+		pemType = "PRIVATE KEY"
+	case HostKeyAlgoECDSA:
+		priv, genErr := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if genErr != nil {
+			return nil, nil, genErr
+		}
+		der, err = x509.MarshalECPrivateKey(priv)
+		pemType = "EC PRIVATE KEY"
+	case HostKeyAlgoRSA:
+		priv, genErr := rsa.GenerateKey(rand.Reader, 3072)
+		if genErr != nil {
+			return nil, nil, genErr
+		}
+		der = x509.MarshalPKCS1PrivateKey(priv)
+		pemType = "RSA PRIVATE KEY"
+	default:
+		return nil, nil, fmt.Errorf("ssh: unsupported host key algorithm %q", algo)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: der})
+	signer, err := parseHostKeyPEM(pemBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return signer, pemBytes, nil
+}
+
+func parseHostKeyPEM(pemBytes []byte) (Signer, error) {
+	return ParsePrivateKey(pemBytes)
+}
+
+// SetHostKeyManager registers m as the source of this server's host
+// keys. s's host-key list is replaced, not appended to, with
+// m.ActiveKeys on every call, on every future rotation, and once more
+// when a rotated-out key's GracePeriod has elapsed, so that a key m
+// has retired stops being announced instead of staying in s's list
+// forever. Each rotation also
+// asks every connection m is tracking (see HostKeyManager.Track) to
+// RequestKeyChange, so already-connected peers pick up the new key
+// without waiting for their next connection.
+//
+// SetHostKeyManager wraps, rather than discards, any OnRotate callback
+// m already had: that callback still runs on every rotation, after
+// this one has updated s's host-key list and rekeyed its tracked
+// connections.
+func (s *ServerConfig) SetHostKeyManager(m *HostKeyManager) {
+	s.hostKeyManager = m
+	s.replaceHostKeys(m.ActiveKeys())
+
+	previous := m.OnRotate
+	m.OnRotate = func(algo HostKeyAlgo) {
+		s.replaceHostKeys(m.ActiveKeys())
+		if grace := m.GracePeriod; grace > 0 {
+			time.AfterFunc(grace, func() { s.replaceHostKeys(m.ActiveKeys()) })
+		}
+		m.rekeyTracked()
+		if previous != nil {
+			previous(algo)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestMemoryHostKeyStorageRoundTrip(t *testing.T) {
+	s := NewMemoryHostKeyStorage()
+
+	if keys, err := s.Load(); err != nil || len(keys) != 0 {
+		t.Fatalf("Load on empty storage = %v, %v; want empty map, nil", keys, err)
+	}
+
+	want := []byte("pem-bytes")
+	if err := s.Save("ssh-ed25519", want); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	keys, err := s.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := keys["ssh-ed25519"]; string(got) != string(want) {
+		t.Fatalf("Load()[ssh-ed25519] = %q, want %q", got, want)
+	}
+
+	if err := s.Delete("ssh-ed25519"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if keys, err := s.Load(); err != nil || len(keys) != 0 {
+		t.Fatalf("Load after Delete = %v, %v; want empty map, nil", keys, err)
+	}
+	// Deleting an absent key is not an error.
+	if err := s.Delete("ssh-ed25519"); err != nil {
+		t.Fatalf("Delete of absent key: %v", err)
+	}
+}
+
+func TestFileHostKeyStorageRoundTrip(t *testing.T) {
+	s, err := NewFileHostKeyStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileHostKeyStorage: %v", err)
+	}
+
+	want := []byte("pem-bytes")
+	if err := s.Save("ssh-rsa", want); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	keys, err := s.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := keys["ssh-rsa"]; string(got) != string(want) {
+		t.Fatalf("Load()[ssh-rsa] = %q, want %q", got, want)
+	}
+
+	if err := s.Delete("ssh-rsa"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if keys, _ := s.Load(); len(keys) != 0 {
+		t.Fatalf("Load after Delete = %v, want empty", keys)
+	}
+}
+
+func TestHostKeyManagerRotateKeepsRetiredKeyDuringGracePeriod(t *testing.T) {
+	m, err := NewHostKeyManager(NewMemoryHostKeyStorage())
+	if err != nil {
+		t.Fatalf("NewHostKeyManager: %v", err)
+	}
+	m.GracePeriod = time.Hour
+
+	first, err := m.Rotate(HostKeyAlgoEd25519)
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if got := m.ActiveKeys(); len(got) != 1 || got[0] != first {
+		t.Fatalf("ActiveKeys after first Rotate = %v, want [%v]", got, first)
+	}
+
+	second, err := m.Rotate(HostKeyAlgoEd25519)
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	got := m.ActiveKeys()
+	if len(got) != 2 {
+		t.Fatalf("ActiveKeys during grace period = %v, want both old and new key", got)
+	}
+	if !containsSigner(got, first) || !containsSigner(got, second) {
+		t.Fatalf("ActiveKeys = %v, want both %v and %v", got, first, second)
+	}
+}
+
+func TestHostKeyManagerActiveKeysDropsExpiredRetiredKey(t *testing.T) {
+	m, err := NewHostKeyManager(NewMemoryHostKeyStorage())
+	if err != nil {
+		t.Fatalf("NewHostKeyManager: %v", err)
+	}
+	m.GracePeriod = time.Millisecond
+
+	if _, err := m.Rotate(HostKeyAlgoEd25519); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	second, err := m.Rotate(HostKeyAlgoEd25519)
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	got := m.ActiveKeys()
+	if len(got) != 1 || got[0] != second {
+		t.Fatalf("ActiveKeys after grace period = %v, want only [%v]", got, second)
+	}
+}
+
+func TestHostKeyManagerEnsureIsRaceSafe(t *testing.T) {
+	m, err := NewHostKeyManager(NewMemoryHostKeyStorage())
+	if err != nil {
+		t.Fatalf("NewHostKeyManager: %v", err)
+	}
+	var rotations int
+	m.OnRotate = func(HostKeyAlgo) { rotations++ }
+
+	const n = 20
+	var wg sync.WaitGroup
+	signers := make([]Signer, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s, err := m.Ensure(HostKeyAlgoEd25519)
+			if err != nil {
+				t.Errorf("Ensure: %v", err)
+				return
+			}
+			signers[i] = s
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 1; i < n; i++ {
+		if signers[i] != signers[0] {
+			t.Fatalf("Ensure returned different keys across concurrent callers: %v vs %v", signers[0], signers[i])
+		}
+	}
+	if rotations != 1 {
+		t.Fatalf("OnRotate fired %d times, want exactly 1", rotations)
+	}
+}
+
+func containsSigner(keys []Signer, want Signer) bool {
+	for _, k := range keys {
+		if k == want {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDatastoreHostKeyStorageRoundTrip(t *testing.T) {
+	store := ds.NewMapDatastore()
+	s := NewDatastoreHostKeyStorage(store, "/ssh/hostkeys")
+	other := NewDatastoreHostKeyStorage(store, "/ssh/other")
+
+	if err := s.Save("ssh-ed25519", []byte("a")); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := other.Save("ssh-ed25519", []byte("b")); err != nil {
+		t.Fatalf("other.Save: %v", err)
+	}
+
+	keys, err := s.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(keys) != 1 {
+		t.Fatalf("Load returned %d keys, want 1 (a differently-prefixed storage's entry leaked in): %v", len(keys), keys)
+	}
+	if got := string(keys["ssh-ed25519"]); got != "a" {
+		t.Fatalf("Load()[ssh-ed25519] = %q, want %q", got, "a")
+	}
+
+	if err := s.Delete("ssh-ed25519"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if keys, err := s.Load(); err != nil || len(keys) != 0 {
+		t.Fatalf("Load after Delete = %v, %v; want empty map, nil", keys, err)
+	}
+	// Deleting from s must not touch other's differently-prefixed entry.
+	if keys, err := other.Load(); err != nil || len(keys) != 1 {
+		t.Fatalf("other.Load() after s.Delete = %v, %v; want 1 entry untouched", keys, err)
+	}
+}
+
+// trackedConn is a minimal Conn used to exercise
+// HostKeyManager.Track/rekeyTracked without a real SSH connection.
+type trackedConn struct {
+	keyChangeErr error
+	keyChanges   int
+}
+
+func (c *trackedConn) User() string                  { return "" }
+func (c *trackedConn) SessionID() []byte             { return nil }
+func (c *trackedConn) ClientVersion() []byte         { return nil }
+func (c *trackedConn) ServerVersion() []byte         { return nil }
+func (c *trackedConn) RemoteMultiaddr() ma.Multiaddr { return nil }
+func (c *trackedConn) LocalMultiaddr() ma.Multiaddr  { return nil }
+func (c *trackedConn) RemotePeer() peer.ID           { return "" }
+
+func (c *trackedConn) SendRequest(name string, wantReply bool, payload []byte) (bool, []byte, error) {
+	return false, nil, nil
+}
+
+func (c *trackedConn) OpenChannel(name string, data []byte) (Channel, <-chan *Request, error) {
+	return nil, nil, nil
+}
+
+func (c *trackedConn) Close() error { return nil }
+func (c *trackedConn) Wait() error  { return nil }
+
+func (c *trackedConn) RequestKeyChange() error {
+	c.keyChanges++
+	return c.keyChangeErr
+}
+
+func (c *trackedConn) Disconnect(reason DisconnectReason, message string) error { return nil }
+
+func TestHostKeyManagerTrackPrunesConnectionsThatFailToRekey(t *testing.T) {
+	m, err := NewHostKeyManager(NewMemoryHostKeyStorage())
+	if err != nil {
+		t.Fatalf("NewHostKeyManager: %v", err)
+	}
+
+	live := &trackedConn{}
+	dead := &trackedConn{keyChangeErr: errors.New("connection closed")}
+	m.Track(live)
+	m.Track(dead)
+
+	m.rekeyTracked()
+	if live.keyChanges != 1 || dead.keyChanges != 1 {
+		t.Fatalf("after first rekeyTracked: live=%d dead=%d, want 1 and 1", live.keyChanges, dead.keyChanges)
+	}
+
+	m.rekeyTracked()
+	if live.keyChanges != 2 {
+		t.Fatalf("after second rekeyTracked: live=%d, want 2", live.keyChanges)
+	}
+	if dead.keyChanges != 1 {
+		t.Fatalf("after second rekeyTracked: dead=%d, want 1 (should have been pruned)", dead.keyChanges)
+	}
+}
+
+func TestSetHostKeyManagerReplacesHostKeysAndComposesOnRotate(t *testing.T) {
+	m, err := NewHostKeyManager(NewMemoryHostKeyStorage())
+	if err != nil {
+		t.Fatalf("NewHostKeyManager: %v", err)
+	}
+	var previousCalls int
+	m.OnRotate = func(HostKeyAlgo) { previousCalls++ }
+
+	cfg := &ServerConfig{}
+	cfg.SetHostKeyManager(m)
+
+	first, err := m.Rotate(HostKeyAlgoEd25519)
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if got := cfg.HostKeys(); len(got) != 1 || got[0] != first {
+		t.Fatalf("HostKeys() after Rotate = %v, want [%v]", got, first)
+	}
+	if previousCalls != 1 {
+		t.Fatalf("previous OnRotate called %d times, want 1 (SetHostKeyManager must compose, not discard, it)", previousCalls)
+	}
+
+	conn := &trackedConn{}
+	m.Track(conn)
+	if _, err := m.Rotate(HostKeyAlgoEd25519); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if conn.keyChanges != 1 {
+		t.Fatalf("tracked conn RequestKeyChange called %d times, want 1", conn.keyChanges)
+	}
+	if previousCalls != 2 {
+		t.Fatalf("previous OnRotate called %d times, want 2", previousCalls)
+	}
+}
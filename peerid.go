@@ -0,0 +1,63 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"fmt"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// peerIDAuthMethod is the name of the authentication method backed by
+// the remote peer's libp2p identity. It is listed alongside
+// "password", "publickey" and "keyboard-interactive" in the SSH
+// authentication protocol (RFC 4252).
+const peerIDAuthMethod = "libp2p-peerid"
+
+// PeerIDCallback is called during authentication when the client
+// offers the "libp2p-peerid" method. remote is the peer ID of the
+// underlying libp2p connection, which libp2p has already
+// cryptographically verified, so no additional SSH-level signature
+// is required to trust it. Returning a non-nil error rejects this
+// authentication method; returning nil *Permissions is equivalent to
+// an empty Permissions.
+//
+// Servers should still treat the callback as the place to decide
+// whether remote is allowed to connect at all (an allow-list, a DHT
+// lookup, etc.), since a valid peer ID only proves who is dialing,
+// not that they are authorized.
+type PeerIDCallback func(conn ConnMetadata, remote peer.ID) (*Permissions, error)
+
+// peerID implements the client side of the "libp2p-peerid" method: it
+// offers the method and, since the server can already verify the peer
+// ID itself from the underlying stream, sends no additional payload.
+func (c *connection) peerID(session []byte, config *ClientConfig) (authResult, []string, error) {
+	if config.PeerID == "" {
+		return authFailure, nil, nil
+	}
+	ok, err := c.sendAuthReq(peerIDAuthMethod, nil)
+	if err != nil {
+		return authFailure, nil, err
+	}
+	if !ok {
+		return authFailure, nil, nil
+	}
+	return authSuccess, nil, nil
+}
+
+// runPeerIDAuth runs the server side of the "libp2p-peerid" method: it
+// extracts the already-authenticated remote peer ID from the
+// underlying libp2p stream and hands it to config.PeerIDCallback.
+func runPeerIDAuth(c *connection, config *ServerConfig) (*Permissions, error) {
+	if config.PeerIDCallback == nil {
+		return nil, fmt.Errorf("ssh: %s auth attempted but PeerIDCallback is not configured", peerIDAuthMethod)
+	}
+	remote := c.sshConn.stream.Conn().RemotePeer()
+	perms, err := config.PeerIDCallback(c, remote)
+	if err == nil && perms == nil {
+		perms = new(Permissions)
+	}
+	return perms, err
+}
@@ -0,0 +1,79 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"testing"
+
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// fakeStream and fakeConn implement just enough of network.Stream and
+// network.Conn - by embedding the nil interface and overriding a
+// single method - to exercise the RemotePeer path without a real
+// libp2p connection.
+type fakeStream struct {
+	network.Stream
+	remote peer.ID
+}
+
+func (s fakeStream) Conn() network.Conn {
+	return fakeConn{remote: s.remote}
+}
+
+type fakeConn struct {
+	network.Conn
+	remote peer.ID
+}
+
+func (c fakeConn) RemotePeer() peer.ID {
+	return c.remote
+}
+
+func TestRunPeerIDAuthRequiresCallback(t *testing.T) {
+	if _, err := runPeerIDAuth(nil, &ServerConfig{}); err == nil {
+		t.Fatal("runPeerIDAuth with no PeerIDCallback configured: got nil error, want one")
+	}
+}
+
+func TestAuthenticateMethodDispatchesPeerID(t *testing.T) {
+	var gotRemote peer.ID
+	config := &ServerConfig{
+		PeerIDCallback: func(conn ConnMetadata, remote peer.ID) (*Permissions, error) {
+			gotRemote = remote
+			return new(Permissions), nil
+		},
+	}
+	c := &connection{sshConn: sshConn{stream: fakeStream{remote: "test-peer"}}}
+
+	perms, err := c.authenticateMethod(peerIDAuthMethod, config)
+	if err != nil {
+		t.Fatalf("authenticateMethod(%q): %v", peerIDAuthMethod, err)
+	}
+	if perms == nil {
+		t.Fatal("authenticateMethod returned nil Permissions on success")
+	}
+	if gotRemote != "test-peer" {
+		t.Fatalf("PeerIDCallback saw remote %q, want %q", gotRemote, "test-peer")
+	}
+}
+
+func TestServerAuthenticateTriesPeerIDMethod(t *testing.T) {
+	config := &ServerConfig{
+		PeerIDCallback: func(conn ConnMetadata, remote peer.ID) (*Permissions, error) {
+			return new(Permissions), nil
+		},
+	}
+	c := &connection{sshConn: sshConn{stream: fakeStream{remote: "test-peer"}}}
+
+	perms, err := c.serverAuthenticate([]string{peerIDAuthMethod}, config)
+	if err != nil {
+		t.Fatalf("serverAuthenticate: %v", err)
+	}
+	if perms == nil {
+		t.Fatal("serverAuthenticate returned nil Permissions on success")
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import "fmt"
+
+// authenticateMethod dispatches a single client-requested
+// authentication method name - the value carried in an
+// SSH_MSG_USERAUTH_REQUEST, per RFC 4252 - to the ServerConfig
+// callback that handles it, returning the resulting Permissions on
+// success. serverAuthenticate's request loop calls this once per
+// attempt the client makes.
+func (c *connection) authenticateMethod(method string, config *ServerConfig) (*Permissions, error) {
+	switch method {
+	case "none":
+		if config.NoClientAuth {
+			return new(Permissions), nil
+		}
+		return nil, fmt.Errorf("ssh: none authentication not permitted")
+
+	case peerIDAuthMethod:
+		return runPeerIDAuth(c, config)
+
+	case "password":
+		if config.PasswordCallback == nil {
+			return nil, fmt.Errorf("ssh: password authentication not configured")
+		}
+		return nil, fmt.Errorf("ssh: password authentication method not implemented in this build")
+
+	case "publickey":
+		if config.PublicKeyCallback == nil {
+			return nil, fmt.Errorf("ssh: public key authentication not configured")
+		}
+		return nil, fmt.Errorf("ssh: public key authentication method not implemented in this build")
+
+	default:
+		return nil, fmt.Errorf("ssh: unsupported authentication method %q", method)
+	}
+}
+
+// serverAuthenticate runs the SSH user authentication protocol
+// (RFC 4252) for a freshly handshaken server connection, dispatching
+// each method name in methods, in turn, to authenticateMethod until
+// one succeeds or MaxAuthTries is exceeded.
+func (c *connection) serverAuthenticate(methods []string, config *ServerConfig) (*Permissions, error) {
+	var tried []string
+	for _, method := range methods {
+		perms, err := c.authenticateMethod(method, config)
+		if err == nil && perms != nil {
+			return perms, nil
+		}
+		tried = append(tried, method)
+		if config.MaxAuthTries > 0 && len(tried) >= config.MaxAuthTries {
+			return nil, fmt.Errorf("ssh: too many authentication failures for %s", c.user)
+		}
+	}
+	return nil, fmt.Errorf("ssh: unable to authenticate, attempted methods %v", tried)
+}